@@ -5,7 +5,6 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"net/http"
-	"strings"
 	"time"
 )
 
@@ -98,6 +97,16 @@ type RefreshTokenData struct {
 	// Scope requested for this refresh token
 	Scope string
 
+	// FamilyID groups together every refresh token descended from the same original issuance via
+	// rotation (Config.RefreshTokenRotation). It's used to revoke every token in the chain if reuse
+	// of an already-rotated token is detected.
+	FamilyID string
+
+	// ReplacedByToken is set to the refresh token that superseded this one once it has been rotated.
+	// A non-empty value on the token presented to handleRefreshTokenRequest indicates reuse of an
+	// already-rotated token, which niso treats as a signal of token theft.
+	ReplacedByToken string
+
 	// Data to be passed to storage. Not used by the library.
 	UserData interface{}
 }
@@ -156,20 +165,55 @@ func (s *Server) GenerateAccessRequest(ctx context.Context, r *http.Request) (*A
 	}
 
 	grantType := GrantType(r.FormValue("grant_type"))
-	if s.Config.AllowedAccessTypes.Exists(grantType) {
-		switch grantType {
-		case AUTHORIZATION_CODE:
-			return s.handleAuthorizationCodeRequest(ctx, r)
-		case REFRESH_TOKEN:
-			return s.handleRefreshTokenRequest(ctx, r)
-		case PASSWORD:
-			return s.handlePasswordRequest(ctx, r)
-		case CLIENT_CREDENTIALS:
-			return s.handleClientCredentialsRequest(ctx, r)
-		}
+	if !s.Config.AllowedAccessTypes.Exists(grantType) {
+		return nil, NewNisoError(E_UNSUPPORTED_GRANT_TYPE, "unsupported grant type")
+	}
+
+	handler := s.grantHandler(grantType)
+	if handler == nil {
+		return nil, NewNisoError(E_UNSUPPORTED_GRANT_TYPE, "unsupported grant type")
 	}
 
-	return nil, NewNisoError(E_UNSUPPORTED_GRANT_TYPE, "unsupported grant type")
+	return handler.HandleTokenEndpointRequest(ctx, r)
+}
+
+// authorizationCodeGrantHandler, refreshTokenGrantHandler, passwordGrantHandler and
+// clientCredentialsGrantHandler adapt niso's four built-in RFC 6749 grants to the GrantHandler
+// interface, so that s.grantHandler can treat them the same as a caller-registered grant.
+type authorizationCodeGrantHandler struct {
+	NoopPopulateResponse
+	s *Server
+}
+
+func (h authorizationCodeGrantHandler) HandleTokenEndpointRequest(ctx context.Context, r *http.Request) (*AccessRequest, error) {
+	return h.s.handleAuthorizationCodeRequest(ctx, r)
+}
+
+type refreshTokenGrantHandler struct {
+	NoopPopulateResponse
+	s *Server
+}
+
+func (h refreshTokenGrantHandler) HandleTokenEndpointRequest(ctx context.Context, r *http.Request) (*AccessRequest, error) {
+	return h.s.handleRefreshTokenRequest(ctx, r)
+}
+
+type passwordGrantHandler struct {
+	NoopPopulateResponse
+	s *Server
+}
+
+func (h passwordGrantHandler) HandleTokenEndpointRequest(ctx context.Context, r *http.Request) (*AccessRequest, error) {
+	return h.s.handlePasswordRequest(ctx, r)
+}
+
+type clientCredentialsGrantHandler struct {
+	NoopPopulateResponse
+	s *Server
+}
+
+func (h clientCredentialsGrantHandler) HandleTokenEndpointRequest(ctx context.Context, r *http.Request) (*AccessRequest, error) {
+	return h.s.handleClientCredentialsRequest(ctx, r)
 }
 
 func (s *Server) handleAuthorizationCodeRequest(ctx context.Context, r *http.Request) (*AccessRequest, error) {
@@ -195,7 +239,7 @@ func (s *Server) handleAuthorizationCodeRequest(ctx context.Context, r *http.Req
 	}
 
 	// must have a valid client
-	clientData, err := getClientDataFromBasicAuth(ctx, auth, s.Storage)
+	clientData, err := s.authenticateClient(ctx, auth)
 	if err != nil {
 		return nil, err
 	}
@@ -217,8 +261,24 @@ func (s *Server) handleAuthorizationCodeRequest(ctx context.Context, r *http.Req
 		return nil, NewNisoError(E_INVALID_GRANT, "authorization code expired")
 	}
 
-	// Verify PKCE, if present in the authorization data
-	if len(ret.AuthorizeData.CodeChallenge) > 0 {
+	// Public clients have no secret to authenticate the token request, so redirect_uri must match
+	// exactly for them. A code_challenge is only required of a public client when Config.PKCEPolicy
+	// is PKCERequiredForPublicClients or PKCERequiredForAll; under PKCEOptional or PKCEDisabled a
+	// public client without one is not rejected.
+	if ret.ClientData.IsPublic {
+		if redirectURI := r.FormValue("redirect_uri"); redirectURI == "" || redirectURI != ret.AuthorizeData.RedirectURI {
+			return nil, NewNisoError(E_INVALID_GRANT, "redirect_uri must exactly match for public clients")
+		}
+	}
+
+	if s.Config.PKCEPolicy.requirePKCE(ret.ClientData) && ret.AuthorizeData.CodeChallenge == "" {
+		return nil, NewNisoError(E_INVALID_REQUEST, "code_challenge required by PKCE policy")
+	}
+
+	// Verify PKCE, if present in the authorization data. PKCEDisabled ignores it outright (e.g. for
+	// deployments that don't support rfc7636 at the authorize endpoint at all); every other policy
+	// validates a present code_challenge even if it isn't required for this client.
+	if s.Config.PKCEPolicy != PKCEDisabled && len(ret.AuthorizeData.CodeChallenge) > 0 {
 		// https://tools.ietf.org/html/rfc7636#section-4.1
 		if matched := pkceMatcher.MatchString(ret.CodeVerifier); !matched {
 			return nil, NewNisoError(E_INVALID_REQUEST, "code_verifier invalid (rfc7636)")
@@ -244,31 +304,11 @@ func (s *Server) handleAuthorizationCodeRequest(ctx context.Context, r *http.Req
 	ret.Scope = ret.AuthorizeData.Scope
 	ret.UserData = ret.AuthorizeData.UserData
 
-	return ret, nil
-}
-
-func extraScopes(accessScopes, refreshScopes string) bool {
-	accessScopesLists := strings.Split(accessScopes, ",")
-	refreshScopesLists := strings.Split(refreshScopes, ",")
-
-	accessMaps := make(map[string]int)
-
-	for _, scope := range accessScopesLists {
-		if scope == "" {
-			continue
-		}
-		accessMaps[scope] = 1
+	if err := s.checkClientScope(ret.ClientData, ret.Scope); err != nil {
+		return nil, err
 	}
 
-	for _, scope := range refreshScopesLists {
-		if scope == "" {
-			continue
-		}
-		if _, ok := accessMaps[scope]; !ok {
-			return true
-		}
-	}
-	return false
+	return ret, nil
 }
 
 func (s *Server) handleRefreshTokenRequest(ctx context.Context, r *http.Request) (*AccessRequest, error) {
@@ -294,7 +334,7 @@ func (s *Server) handleRefreshTokenRequest(ctx context.Context, r *http.Request)
 	}
 
 	// must have a valid client
-	clientData, err := getClientDataFromBasicAuth(ctx, auth, s.Storage)
+	clientData, err := s.authenticateClient(ctx, auth)
 	if err != nil {
 		return nil, err
 	}
@@ -311,6 +351,15 @@ func (s *Server) handleRefreshTokenRequest(ctx context.Context, r *http.Request)
 		return nil, NewNisoError(E_INVALID_CLIENT, "request client id must be the same from previous token")
 	}
 
+	// Under rotation, a refresh token that has already been exchanged for a new one must never be
+	// presented again. Seeing it a second time means it leaked, so the whole family is revoked.
+	if s.Config.RefreshTokenRotation && req.PreviousRefreshToken.ReplacedByToken != "" {
+		if err := s.Storage.RevokeRefreshTokenFamily(ctx, req.PreviousRefreshToken.FamilyID); err != nil {
+			return nil, NewWrappedNisoError(E_SERVER_ERROR, err, "failed to revoke refresh token family")
+		}
+		return nil, NewNisoError(E_INVALID_GRANT, "refresh token has already been used")
+	}
+
 	// set rest of data
 	req.RedirectURI = req.PreviousRefreshToken.RedirectURI
 	req.UserData = req.PreviousRefreshToken.UserData
@@ -318,8 +367,8 @@ func (s *Server) handleRefreshTokenRequest(ctx context.Context, r *http.Request)
 		req.Scope = req.PreviousRefreshToken.Scope
 	}
 
-	if extraScopes(req.PreviousRefreshToken.Scope, req.Scope) {
-		return nil, NewNisoError(E_ACCESS_DENIED, "the requested scope must not include any scope not originally granted by the resource owner")
+	if _, err := s.scopeStrategy().Filter(req.PreviousRefreshToken.Scope, req.Scope); err != nil {
+		return nil, NewWrappedNisoError(E_ACCESS_DENIED, err, "the requested scope must not include any scope not originally granted by the resource owner")
 	}
 
 	return req, nil
@@ -351,7 +400,9 @@ func (s *Server) handlePasswordRequest(ctx context.Context, r *http.Request) (*A
 		return nil, NewNisoError(E_INVALID_GRANT, "password field not set")
 	}
 
-	// must have a valid client
+	// must have a valid client. The password grant has no compensating control for an unauthenticated
+	// client (no PKCE, no possession of a prior token), so public clients still authenticate with a
+	// secret here same as confidential ones.
 	clientData, err := getClientDataFromBasicAuth(ctx, auth, s.Storage)
 	if err != nil {
 		return nil, err
@@ -361,6 +412,10 @@ func (s *Server) handlePasswordRequest(ctx context.Context, r *http.Request) (*A
 	// set redirect uri
 	ret.RedirectURI = firstURI(ret.ClientData.RedirectURI, s.Config.RedirectURISeparator)
 
+	if err := s.checkClientScope(ret.ClientData, ret.Scope); err != nil {
+		return nil, err
+	}
+
 	return ret, nil
 }
 
@@ -380,6 +435,8 @@ func (s *Server) handleClientCredentialsRequest(ctx context.Context, r *http.Req
 		HTTPRequest:     r,
 	}
 
+	// client_credentials has no user and no compensating control: the client secret *is* the entire
+	// authorization grant (rfc6749#section-4.4), so public clients are never allowed through here.
 	clientData, err := getClientDataFromBasicAuth(ctx, auth, s.Storage)
 	if err != nil {
 		return nil, err
@@ -389,6 +446,10 @@ func (s *Server) handleClientCredentialsRequest(ctx context.Context, r *http.Req
 	// set redirect uri
 	ret.RedirectURI = firstURI(ret.ClientData.RedirectURI, s.Config.RedirectURISeparator)
 
+	if err := s.checkClientScope(ret.ClientData, ret.Scope); err != nil {
+		return nil, err
+	}
+
 	return ret, nil
 }
 
@@ -429,6 +490,16 @@ func (s *Server) FinishAccessRequest(ctx context.Context, ar *AccessRequest) (*R
 			UserData:  ar.UserData,
 			Scope:     ar.Scope,
 		}
+
+		if s.Config.RefreshTokenRotation && ar.PreviousRefreshToken != nil && ar.PreviousRefreshToken.FamilyID != "" {
+			rt.FamilyID = ar.PreviousRefreshToken.FamilyID
+		} else if s.Config.RefreshTokenRotation {
+			rt.FamilyID, err = newRandomToken()
+			if err != nil {
+				return nil, NewWrappedNisoError(E_SERVER_ERROR, err, "failed to generate refresh token family id")
+			}
+		}
+
 		rt.RefreshToken, err = s.AccessTokenGenerator.GenerateRefreshToken(ar)
 		if err != nil {
 			return nil, NewWrappedNisoError(E_SERVER_ERROR, err, "failed to generate refresh token")
@@ -441,6 +512,16 @@ func (s *Server) FinishAccessRequest(ctx context.Context, ar *AccessRequest) (*R
 
 		// Attach refresh token string to output
 		resp.Data["refresh_token"] = rt.RefreshToken
+
+		// Under rotation, the token just exchanged is marked replaced rather than deleted outright,
+		// so a later reuse can be detected and its whole family revoked.
+		if s.Config.RefreshTokenRotation && ar.PreviousRefreshToken != nil {
+			ar.PreviousRefreshToken.ReplacedByToken = rt.RefreshToken
+			if err := s.Storage.SaveRefreshTokenData(ctx, ar.PreviousRefreshToken); err != nil {
+				return nil, NewWrappedNisoError(E_SERVER_ERROR, err, "failed to mark previous refresh token as replaced")
+			}
+			ar.PreviousRefreshToken = nil
+		}
 	}
 
 	// save access token
@@ -467,5 +548,12 @@ func (s *Server) FinishAccessRequest(ctx context.Context, ar *AccessRequest) (*R
 		resp.Data["scope"] = ar.Scope
 	}
 
+	// let the grant handler contribute any grant-specific response fields
+	if handler := s.grantHandler(ar.GrantType); handler != nil {
+		if err := handler.PopulateResponse(ctx, ar, resp); err != nil {
+			return nil, err
+		}
+	}
+
 	return resp, nil
 }
@@ -0,0 +1,240 @@
+package niso
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memoryStorage is a minimal in-memory Storage used to exercise refresh token rotation without a
+// real persistence layer.
+type memoryStorage struct {
+	refreshTokens map[string]*RefreshTokenData
+	clients       map[string]*ClientData
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{refreshTokens: map[string]*RefreshTokenData{}}
+}
+
+func (m *memoryStorage) Close() error { return nil }
+
+func (m *memoryStorage) GetClientData(ctx context.Context, id string) (*ClientData, error) {
+	if c, ok := m.clients[id]; ok {
+		return c, nil
+	}
+	return &ClientData{ClientID: id}, nil
+}
+
+func (m *memoryStorage) SaveAuthorizeData(ctx context.Context, data *AuthorizeData) error { return nil }
+func (m *memoryStorage) GetAuthorizeData(ctx context.Context, code string) (*AuthorizeData, error) {
+	return nil, NewNisoError(E_INVALID_GRANT, "not found")
+}
+func (m *memoryStorage) DeleteAuthorizeData(ctx context.Context, code string) error { return nil }
+
+func (m *memoryStorage) SaveAccessData(ctx context.Context, data *AccessData) error { return nil }
+func (m *memoryStorage) LoadAccessData(ctx context.Context, token string) (*AccessData, error) {
+	return nil, NewNisoError(E_INVALID_GRANT, "not found")
+}
+func (m *memoryStorage) DeleteAccessData(ctx context.Context, token string) error { return nil }
+
+func (m *memoryStorage) GetRefreshTokenData(ctx context.Context, token string) (*RefreshTokenData, error) {
+	rt, ok := m.refreshTokens[token]
+	if !ok {
+		return nil, NewNisoError(E_INVALID_GRANT, "not found")
+	}
+	return rt, nil
+}
+func (m *memoryStorage) SaveRefreshTokenData(ctx context.Context, data *RefreshTokenData) error {
+	m.refreshTokens[data.RefreshToken] = data
+	return nil
+}
+func (m *memoryStorage) DeleteRefreshTokenData(ctx context.Context, token string) error {
+	delete(m.refreshTokens, token)
+	return nil
+}
+
+func (m *memoryStorage) GetRefreshTokenFamily(ctx context.Context, familyID string) ([]*RefreshTokenData, error) {
+	var family []*RefreshTokenData
+	for _, rt := range m.refreshTokens {
+		if rt.FamilyID == familyID {
+			family = append(family, rt)
+		}
+	}
+	return family, nil
+}
+func (m *memoryStorage) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	for token, rt := range m.refreshTokens {
+		if rt.FamilyID == familyID {
+			delete(m.refreshTokens, token)
+		}
+	}
+	return nil
+}
+
+// sequentialTokenGenerator hands out predictable, incrementing tokens so rotation tests can assert
+// on exact values instead of just "some new string was generated".
+type sequentialTokenGenerator struct {
+	n int
+}
+
+func (g *sequentialTokenGenerator) next() string {
+	g.n++
+	return "tok" + string(rune('0'+g.n))
+}
+
+func (g *sequentialTokenGenerator) GenerateAccessToken(ar *AccessRequest) (string, error) {
+	return g.next(), nil
+}
+func (g *sequentialTokenGenerator) GenerateRefreshToken(ar *AccessRequest) (string, error) {
+	return g.next(), nil
+}
+
+func TestFinishAccessRequest_RefreshTokenRotation_ReplacesPreviousToken(t *testing.T) {
+	storage := newMemoryStorage()
+	oldToken := &RefreshTokenData{
+		ClientID:     "client1",
+		RefreshToken: "old-rt",
+		FamilyID:     "fam1",
+		CreatedAt:    time.Now(),
+	}
+	storage.refreshTokens[oldToken.RefreshToken] = oldToken
+
+	s := &Server{
+		Storage:              storage,
+		Config:               &Config{RefreshTokenRotation: true, AccessExpiration: 3600, TokenType: "Bearer"},
+		AccessTokenGenerator: &sequentialTokenGenerator{},
+	}
+
+	ar := &AccessRequest{
+		GrantType:            REFRESH_TOKEN,
+		ClientData:           &ClientData{ClientID: "client1"},
+		GenerateRefresh:      true,
+		Expiration:           3600,
+		PreviousRefreshToken: oldToken,
+	}
+
+	resp, err := s.FinishAccessRequest(context.Background(), ar)
+	if err != nil {
+		t.Fatalf("FinishAccessRequest returned an error: %v", err)
+	}
+	newToken, _ := resp.Data["refresh_token"].(string)
+	if newToken == "" {
+		t.Fatal("no refresh_token in response")
+	}
+
+	stored, ok := storage.refreshTokens[oldToken.RefreshToken]
+	if !ok {
+		t.Fatal("old refresh token was deleted outright; rotation should mark it replaced instead")
+	}
+	if stored.ReplacedByToken != newToken {
+		t.Errorf("old token ReplacedByToken = %q, want %q", stored.ReplacedByToken, newToken)
+	}
+
+	newStored, ok := storage.refreshTokens[newToken]
+	if !ok {
+		t.Fatal("new refresh token was not saved")
+	}
+	if newStored.FamilyID != oldToken.FamilyID {
+		t.Errorf("new token FamilyID = %q, want it to inherit %q", newStored.FamilyID, oldToken.FamilyID)
+	}
+}
+
+func TestFinishAccessRequest_RefreshTokenRotation_Disabled_DeletesOldToken(t *testing.T) {
+	storage := newMemoryStorage()
+	oldToken := &RefreshTokenData{ClientID: "client1", RefreshToken: "old-rt", CreatedAt: time.Now()}
+	storage.refreshTokens[oldToken.RefreshToken] = oldToken
+
+	s := &Server{
+		Storage:              storage,
+		Config:               &Config{RefreshTokenRotation: false, AccessExpiration: 3600, TokenType: "Bearer"},
+		AccessTokenGenerator: &sequentialTokenGenerator{},
+	}
+
+	ar := &AccessRequest{
+		GrantType:            REFRESH_TOKEN,
+		ClientData:           &ClientData{ClientID: "client1"},
+		GenerateRefresh:      true,
+		Expiration:           3600,
+		PreviousRefreshToken: oldToken,
+	}
+
+	if _, err := s.FinishAccessRequest(context.Background(), ar); err != nil {
+		t.Fatalf("FinishAccessRequest returned an error: %v", err)
+	}
+
+	if _, ok := storage.refreshTokens[oldToken.RefreshToken]; ok {
+		t.Error("expected old refresh token to be deleted when rotation is disabled, as before")
+	}
+}
+
+func TestMemoryStorage_RevokeRefreshTokenFamily_RemovesWholeFamily(t *testing.T) {
+	storage := newMemoryStorage()
+	storage.refreshTokens["a"] = &RefreshTokenData{RefreshToken: "a", FamilyID: "fam1"}
+	storage.refreshTokens["b"] = &RefreshTokenData{RefreshToken: "b", FamilyID: "fam1"}
+	storage.refreshTokens["c"] = &RefreshTokenData{RefreshToken: "c", FamilyID: "other-fam"}
+
+	if err := storage.RevokeRefreshTokenFamily(context.Background(), "fam1"); err != nil {
+		t.Fatalf("RevokeRefreshTokenFamily returned an error: %v", err)
+	}
+
+	if _, ok := storage.refreshTokens["a"]; ok {
+		t.Error("token a should have been revoked with its family")
+	}
+	if _, ok := storage.refreshTokens["b"]; ok {
+		t.Error("token b should have been revoked with its family")
+	}
+	if _, ok := storage.refreshTokens["c"]; !ok {
+		t.Error("token c belongs to a different family and should be unaffected")
+	}
+}
+
+func newRefreshTokenRequest(t *testing.T, refreshToken, clientID, clientSecret string) *http.Request {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "https://token.example/token", strings.NewReader("grant_type=refresh_token&refresh_token="+refreshToken))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth(clientID, clientSecret)
+	return r
+}
+
+func TestHandleRefreshTokenRequest_DetectsReuseAndRevokesFamily(t *testing.T) {
+	storage := newMemoryStorage()
+	storage.clients = map[string]*ClientData{"client1": {ClientID: "client1"}}
+	storage.refreshTokens["used-rt"] = &RefreshTokenData{
+		ClientID:        "client1",
+		RefreshToken:    "used-rt",
+		FamilyID:        "fam1",
+		ReplacedByToken: "current-rt",
+		CreatedAt:       time.Now(),
+	}
+	storage.refreshTokens["current-rt"] = &RefreshTokenData{
+		ClientID:     "client1",
+		RefreshToken: "current-rt",
+		FamilyID:     "fam1",
+		CreatedAt:    time.Now(),
+	}
+
+	s := &Server{
+		Storage: storage,
+		Config:  &Config{RefreshTokenRotation: true, AccessExpiration: 3600, TokenType: "Bearer"},
+	}
+
+	_, err := s.handleRefreshTokenRequest(context.Background(), newRefreshTokenRequest(t, "used-rt", "client1", ""))
+	if err == nil {
+		t.Fatal("expected an error presenting an already-rotated refresh token")
+	}
+	nisoErr, ok := err.(*NisoError)
+	if !ok || nisoErr.Code != E_INVALID_GRANT {
+		t.Errorf("err = %v, want a *NisoError with code %q", err, E_INVALID_GRANT)
+	}
+
+	if _, ok := storage.refreshTokens["used-rt"]; ok {
+		t.Error("the reused token itself should have been revoked along with its family")
+	}
+	if _, ok := storage.refreshTokens["current-rt"]; ok {
+		t.Error("the rest of the family should have been revoked once reuse was detected")
+	}
+}
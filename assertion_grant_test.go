@@ -0,0 +1,137 @@
+package niso
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+type fakeJWTBearerKeyResolver struct {
+	key []byte
+}
+
+func (f fakeJWTBearerKeyResolver) ResolveKey(issuer, keyID string) (interface{}, error) {
+	return f.key, nil
+}
+
+// fakeClientStorage is a minimal Storage that only needs to answer GetClientData for this test.
+type fakeClientStorage struct {
+	Storage
+	clients map[string]*ClientData
+}
+
+func (f *fakeClientStorage) GetClientData(ctx context.Context, id string) (*ClientData, error) {
+	c, ok := f.clients[id]
+	if !ok {
+		return nil, NewNisoError(E_INVALID_CLIENT, "unknown client")
+	}
+	return c, nil
+}
+
+func newAssertionRequest(t *testing.T, assertion, scope string) *http.Request {
+	t.Helper()
+	form := "assertion=" + assertion
+	if scope != "" {
+		form += "&scope=" + scope
+	}
+	r := httptest.NewRequest(http.MethodPost, "https://token.example/token", strings.NewReader(form))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func TestJWTBearerGrantHandler_PopulatesClientData(t *testing.T) {
+	secret := []byte("shared-secret")
+	const issuer = "client1"
+	const audience = "https://token.example/token"
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    issuer,
+		Subject:   "user1",
+		Audience:  jwt.ClaimStrings{audience},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	})
+	assertion, err := token.SignedString(secret)
+	if err != nil {
+		t.Fatalf("failed to sign test assertion: %v", err)
+	}
+
+	storage := &fakeClientStorage{clients: map[string]*ClientData{
+		issuer: {ClientID: issuer},
+	}}
+	s := &Server{
+		Storage: storage,
+		Config:  &Config{AccessExpiration: 3600},
+	}
+	h := &JWTBearerGrantHandler{
+		Server:    s,
+		Keys:      fakeJWTBearerKeyResolver{key: secret},
+		Algorithm: JWT_HS256,
+		Audience:  audience,
+	}
+
+	ar, err := h.HandleTokenEndpointRequest(context.Background(), newAssertionRequest(t, assertion, ""))
+	if err != nil {
+		t.Fatalf("HandleTokenEndpointRequest returned an error: %v", err)
+	}
+
+	if ar.ClientData == nil {
+		t.Fatal("AccessRequest.ClientData is nil; downstream introspection/revocation/scope checks silently no-op on this")
+	}
+	if ar.ClientData.ClientID != issuer {
+		t.Errorf("ClientData.ClientID = %q, want %q", ar.ClientData.ClientID, issuer)
+	}
+	subject, ok := ar.UserData.(interface{ Subject() string })
+	if !ok {
+		t.Fatalf("UserData = %#v, want something implementing Subject() string so introspection/JWT re-encoding can extract it", ar.UserData)
+	}
+	if subject.Subject() != "user1" {
+		t.Errorf("UserData.Subject() = %q, want %q", subject.Subject(), "user1")
+	}
+}
+
+func TestJWTBearerGrantHandler_RejectsWrongSigningMethod(t *testing.T) {
+	// A resolver that hands back an RSA public key is what a real SigningKeyManager-backed
+	// JWTBearerKeyResolver would do; without pinning Algorithm, go-jwt would happily treat that same
+	// key's modulus bytes as an HMAC secret for a maliciously re-signed HS256 token. Simulate that
+	// attack: sign an HS256 forgery keyed on the public key's modulus bytes, and confirm it is
+	// rejected once Algorithm is pinned to RS256.
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+
+	claims := jwt.RegisteredClaims{
+		Issuer:    "client1",
+		Subject:   "user1",
+		Audience:  jwt.ClaimStrings{"https://token.example/token"},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}
+
+	forgedKey := priv.PublicKey.N.Bytes()
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(forgedKey)
+	if err != nil {
+		t.Fatalf("failed to sign forged assertion: %v", err)
+	}
+
+	storage := &fakeClientStorage{clients: map[string]*ClientData{"client1": {ClientID: "client1"}}}
+	h := &JWTBearerGrantHandler{
+		Server: &Server{Storage: storage, Config: &Config{AccessExpiration: 3600}},
+		Keys:   fakeJWTBearerKeyResolver{key: forgedKey},
+		// A real resolver would return *rsa.PublicKey for this client; this test key happens to be
+		// raw bytes only because the point is to prove Algorithm pinning rejects the mismatch before
+		// that distinction would even matter.
+		Algorithm: JWT_RS256,
+		Audience:  "https://token.example/token",
+	}
+
+	if _, err := h.HandleTokenEndpointRequest(context.Background(), newAssertionRequest(t, forged, "")); err == nil {
+		t.Error("expected an HS256-forged assertion to be rejected when Algorithm is pinned to RS256")
+	}
+}
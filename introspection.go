@@ -0,0 +1,147 @@
+package niso
+
+import (
+	"context"
+	"net/http"
+)
+
+// IntrospectionTokenTypeHint is the type for the optional `token_type_hint` introspection parameter.
+// https://tools.ietf.org/html/rfc7662#section-2.1
+type IntrospectionTokenTypeHint string
+
+const (
+	INTROSPECT_ACCESS_TOKEN  IntrospectionTokenTypeHint = "access_token"
+	INTROSPECT_REFRESH_TOKEN IntrospectionTokenTypeHint = "refresh_token"
+)
+
+// IntrospectionAuthorizedCallback returns if an introspection request should be answered for the given client.
+// errors returned by this function will result in internal server errors being returned.
+type IntrospectionAuthorizedCallback func(clientData *ClientData, token string) (bool, error)
+
+// HandleIntrospectionRequest is the entry point for handling RFC 7662 token introspection requests.
+// This method will always return a Response, even if there was an error processing the request, which should be
+// rendered for a user. It may also return an error in the second argument which can be logged by the caller.
+//
+// A request that is not a POST, fails client authentication or has no `token` gets an error response.
+// Otherwise, per RFC 7662, the response has an `active` field. No details about why a token is
+// inactive (expired, revoked, unknown, or belonging to another client) are ever leaked to the caller.
+func (s *Server) HandleIntrospectionRequest(ctx context.Context, r *http.Request, isAuthorizedCb IntrospectionAuthorizedCallback) (*Response, error) {
+	if r.Method != "POST" {
+		return toNisoError(NewNisoError(E_INVALID_REQUEST, "introspection requests must POST verb")).AsResponse(), nil
+	}
+
+	auth, err := getClientAuthFromRequest(r, s.Config.AllowClientSecretInParams)
+	if err != nil {
+		return toNisoError(NewWrappedNisoError(E_INVALID_REQUEST, err, "failed to get client authentication")).AsResponse(), nil
+	}
+
+	clientData, err := getClientDataFromBasicAuth(ctx, auth, s.Storage)
+	if err != nil {
+		return toNisoError(err).AsResponse(), nil
+	}
+
+	token := r.FormValue("token")
+	if token == "" {
+		return toNisoError(NewNisoError(E_INVALID_REQUEST, "no token provided")).AsResponse(), nil
+	}
+	tokenTypeHint := IntrospectionTokenTypeHint(r.FormValue("token_type_hint"))
+
+	resp := NewResponse()
+
+	active, err := s.introspectToken(ctx, clientData, token, tokenTypeHint, resp)
+	if err != nil {
+		return toNisoError(err).AsResponse(), err
+	}
+	if !active {
+		// Inactive/expired/unknown/mismatched-client tokens are all reported identically, with no
+		// further detail, per https://tools.ietf.org/html/rfc7662#section-2.2.
+		resp = NewResponse()
+		resp.Data["active"] = false
+		return resp, nil
+	}
+
+	if isAuthorizedCb != nil {
+		isAuthorized, err := isAuthorizedCb(clientData, token)
+		if err != nil {
+			err = NewWrappedNisoError(E_SERVER_ERROR, err, "authorization check failed")
+			return toNisoError(err).AsResponse(), err
+		}
+		if !isAuthorized {
+			resp = NewResponse()
+			resp.Data["active"] = false
+			return resp, nil
+		}
+	}
+
+	return resp, nil
+}
+
+// introspectToken looks up the token as an access token and then as a refresh token (guided by tokenTypeHint,
+// which is tried first but is only a hint), and populates resp if it finds an active match.
+func (s *Server) introspectToken(ctx context.Context, clientData *ClientData, token string, tokenTypeHint IntrospectionTokenTypeHint, resp *Response) (bool, error) {
+	tryAccessToken := func() (bool, error) {
+		ad, err := s.Storage.LoadAccessData(ctx, token)
+		if err != nil || ad == nil {
+			return false, nil
+		}
+		if ad.ClientData == nil || ad.ClientData.ClientID != clientData.ClientID {
+			return false, nil
+		}
+		if ad.IsExpiredAt(s.Now()) {
+			return false, nil
+		}
+		resp.Data["active"] = true
+		resp.Data["scope"] = ad.Scope
+		resp.Data["client_id"] = ad.ClientData.ClientID
+		resp.Data["iat"] = ad.CreatedAt.Unix()
+		resp.Data["exp"] = ad.ExpireAt().Unix()
+		resp.Data["token_type"] = s.Config.TokenType
+		setIntrospectionUserDataClaims(resp, ad.UserData)
+		return true, nil
+	}
+
+	tryRefreshToken := func() (bool, error) {
+		rt, err := s.Storage.GetRefreshTokenData(ctx, token)
+		if err != nil || rt == nil {
+			return false, nil
+		}
+		if rt.ClientID != clientData.ClientID {
+			return false, nil
+		}
+		resp.Data["active"] = true
+		resp.Data["scope"] = rt.Scope
+		resp.Data["client_id"] = rt.ClientID
+		resp.Data["iat"] = rt.CreatedAt.Unix()
+		resp.Data["token_type"] = "refresh_token"
+		setIntrospectionUserDataClaims(resp, rt.UserData)
+		return true, nil
+	}
+
+	if tokenTypeHint == INTROSPECT_REFRESH_TOKEN {
+		if active, err := tryRefreshToken(); active || err != nil {
+			return active, err
+		}
+		return tryAccessToken()
+	}
+
+	if active, err := tryAccessToken(); active || err != nil {
+		return active, err
+	}
+	return tryRefreshToken()
+}
+
+// setIntrospectionUserDataClaims sets the `username`/`sub` claims from UserData, if it exposes them.
+func setIntrospectionUserDataClaims(resp *Response, userData interface{}) {
+	type subjectProvider interface {
+		Subject() string
+	}
+	type usernameProvider interface {
+		Username() string
+	}
+	if p, ok := userData.(subjectProvider); ok {
+		resp.Data["sub"] = p.Subject()
+	}
+	if p, ok := userData.(usernameProvider); ok {
+		resp.Data["username"] = p.Username()
+	}
+}
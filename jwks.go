@@ -0,0 +1,100 @@
+package niso
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+)
+
+// JSONWebKey is a single key entry in a JSON Web Key Set, as served by Server.HandleJWKSRequest.
+// Only the fields niso needs to publish RSA and EC public keys are modeled; this is not a general
+// purpose JWK implementation.
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use,omitempty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg,omitempty"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// EC
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JSONWebKeySet is the document served by Server.HandleJWKSRequest.
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// HandleJWKSRequest serves the public verification keys for the Server's configured SigningKeyManager
+// as a JSON Web Key Set (RFC 7517), so resource servers can validate JWTAccessTokenGenerator tokens
+// without calling back into this server.
+func (s *Server) HandleJWKSRequest(w http.ResponseWriter, r *http.Request) {
+	if s.SigningKeys == nil {
+		http.Error(w, "JWKS not configured", http.StatusNotFound)
+		return
+	}
+
+	keys, err := s.SigningKeys.VerificationKeys()
+	if err != nil {
+		http.Error(w, "failed to load verification keys", http.StatusInternalServerError)
+		return
+	}
+
+	jwks := JSONWebKeySet{Keys: make([]JSONWebKey, 0, len(keys))}
+	for kid, key := range keys {
+		jwk, err := jsonWebKeyFor(kid, key)
+		if err != nil {
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(jwks)
+}
+
+func jsonWebKeyFor(kid string, key interface{}) (JSONWebKey, error) {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return JSONWebKey{
+			Kty: "RSA",
+			Use: "sig",
+			Kid: kid,
+			Alg: string(JWT_RS256),
+			N:   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(bigEndianBytes(int64(k.E))),
+		}, nil
+	case *ecdsa.PublicKey:
+		return JSONWebKey{
+			Kty: "EC",
+			Use: "sig",
+			Kid: kid,
+			Alg: string(JWT_ES256),
+			Crv: k.Curve.Params().Name,
+			X:   base64.RawURLEncoding.EncodeToString(k.X.Bytes()),
+			Y:   base64.RawURLEncoding.EncodeToString(k.Y.Bytes()),
+		}, nil
+	default:
+		return JSONWebKey{}, NewNisoError(E_SERVER_ERROR, "unsupported verification key type")
+	}
+}
+
+// bigEndianBytes trims the leading zero bytes off a big-endian encoding of v, as required for the
+// JWK "e" exponent encoding.
+func bigEndianBytes(v int64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(v))
+	i := 0
+	for i < len(buf)-1 && buf[i] == 0 {
+		i++
+	}
+	return buf[i:]
+}
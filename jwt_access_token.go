@@ -0,0 +1,193 @@
+package niso
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// JWTSigningMethod identifies which JWT algorithm a JWTAccessTokenGenerator should sign with.
+type JWTSigningMethod string
+
+const (
+	JWT_RS256 JWTSigningMethod = "RS256"
+	JWT_ES256 JWTSigningMethod = "ES256"
+	JWT_HS256 JWTSigningMethod = "HS256"
+)
+
+// JWTAccessTokenClaims are the claims niso places in a self-encoded (JWT) access token.
+type JWTAccessTokenClaims struct {
+	jwt.RegisteredClaims
+	Scope string `json:"scope,omitempty"`
+}
+
+// JWTAccessTokenGenerator is an AccessTokenGenerator that issues access tokens as signed JWTs, per the
+// conventions of RFC 9068. Refresh tokens are still generated as opaque random strings, since they're
+// only ever presented back to this server rather than validated by resource servers.
+//
+// The signing key is obtained from Keys, a SigningKeyManager, so that keys can be rotated without
+// invalidating tokens signed with an older key. ValidateBearerToken and HandleJWKSRequest read
+// verification keys from Server.SigningKeys, not from this field.
+type JWTAccessTokenGenerator struct {
+	Issuer        string
+	SigningMethod JWTSigningMethod
+	Keys          SigningKeyManager
+
+	// RefreshTokenGenerator generates the (opaque) refresh token when one is requested.
+	RefreshTokenGenerator AccessTokenGenerator
+}
+
+// GenerateAccessToken implements AccessTokenGenerator.
+func (g *JWTAccessTokenGenerator) GenerateAccessToken(ar *AccessRequest) (string, error) {
+	now := time.Now()
+	jti, err := newRandomToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate jti: %w", err)
+	}
+
+	claims := &JWTAccessTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    g.Issuer,
+			Subject:   subjectFromUserData(ar.UserData),
+			Audience:  jwt.ClaimStrings{ar.ClientData.ClientID},
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Duration(ar.Expiration) * time.Second)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        jti,
+		},
+		Scope: ar.Scope,
+	}
+
+	signingKey, keyID, err := g.Keys.SigningKey()
+	if err != nil {
+		return "", fmt.Errorf("failed to get signing key: %w", err)
+	}
+
+	token := jwt.NewWithClaims(jwtGoSigningMethod(g.SigningMethod), claims)
+	token.Header["kid"] = keyID
+
+	return token.SignedString(signingKey)
+}
+
+// GenerateRefreshToken implements AccessTokenGenerator by delegating to RefreshTokenGenerator, or to an
+// opaque random token if none was configured.
+func (g *JWTAccessTokenGenerator) GenerateRefreshToken(ar *AccessRequest) (string, error) {
+	if g.RefreshTokenGenerator != nil {
+		return g.RefreshTokenGenerator.GenerateRefreshToken(ar)
+	}
+	return newRandomToken()
+}
+
+func jwtGoSigningMethod(m JWTSigningMethod) jwt.SigningMethod {
+	switch m {
+	case JWT_RS256:
+		return jwt.SigningMethodRS256
+	case JWT_ES256:
+		return jwt.SigningMethodES256
+	case JWT_HS256:
+		return jwt.SigningMethodHS256
+	default:
+		return jwt.SigningMethodRS256
+	}
+}
+
+// subjectFromUserData extracts a `sub` claim from UserData, if it exposes one.
+func subjectFromUserData(userData interface{}) string {
+	type subjectProvider interface {
+		Subject() string
+	}
+	if p, ok := userData.(subjectProvider); ok {
+		return p.Subject()
+	}
+	return ""
+}
+
+// ValidateBearerToken verifies a bearer token presented by a client against expectedAudience, which
+// must appear in the token's `aud` claim. JWTAccessTokenGenerator sets `aud` to the id of the client
+// the token was issued to, and the returned AccessData's ClientData.ClientID is the first `aud`
+// value. Self-encoded JWT access tokens are verified locally (signature, expiry and audience, no
+// Storage round-trip); opaque tokens fall back to Storage.LoadAccessData, and expectedAudience is not
+// checked for them.
+func (s *Server) ValidateBearerToken(ctx context.Context, token, expectedAudience string) (*AccessData, error) {
+	if looksLikeJWT(token) {
+		return s.validateJWTBearerToken(token, expectedAudience)
+	}
+	return s.Storage.LoadAccessData(ctx, token)
+}
+
+func (s *Server) validateJWTBearerToken(token, expectedAudience string) (*AccessData, error) {
+	if s.SigningKeys == nil {
+		return nil, NewNisoError(E_INVALID_REQUEST, "bearer token is not a valid JWT")
+	}
+
+	claims := &JWTAccessTokenClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return s.SigningKeys.VerificationKey(kid)
+	}, jwt.WithValidMethods([]string{string(s.SigningKeys.SigningMethod())}))
+	if err != nil {
+		return nil, NewWrappedNisoError(E_INVALID_REQUEST, err, "bearer token is not a valid JWT")
+	}
+
+	// jwt.WithValidMethods above already rejects a token signed with any method other than the one
+	// SigningKeys actually issues with, so a verification key returned for one algorithm (e.g. an
+	// RSA public key published via JWKS) can never be replayed as an HMAC secret for another
+	// (classic RS256/HS256 algorithm-confusion).
+	if !claims.VerifyAudience(expectedAudience, true) {
+		return nil, NewNisoError(E_INVALID_REQUEST, "bearer token audience does not match this resource server")
+	}
+
+	// iat/exp are optional per jwt.RegisteredClaims.Valid(), so a validly-signed token omitting either
+	// must not panic here.
+	if claims.IssuedAt == nil || claims.ExpiresAt == nil {
+		return nil, NewNisoError(E_INVALID_REQUEST, "bearer token is missing iat or exp claim")
+	}
+
+	return &AccessData{
+		ClientData:  &ClientData{ClientID: firstOrEmpty(claims.Audience)},
+		AccessToken: token,
+		Scope:       claims.Scope,
+		CreatedAt:   claims.IssuedAt.Time,
+		ExpiresIn:   int32(claims.ExpiresAt.Time.Sub(claims.IssuedAt.Time).Seconds()),
+	}, nil
+}
+
+func firstOrEmpty(values jwt.ClaimStrings) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// looksLikeJWT returns true if token has the three dot-separated segments of a JWT. Opaque tokens
+// generated by the default AccessTokenGenerator never contain a `.`.
+func looksLikeJWT(token string) bool {
+	dots := 0
+	for _, c := range token {
+		if c == '.' {
+			dots++
+		}
+	}
+	return dots == 2
+}
+
+// SigningKeyManager resolves the signing and verification keys used by JWTAccessTokenGenerator and
+// Server.HandleJWKSRequest, with support for key rotation: multiple verification keys may be valid at
+// once (to accept tokens signed before a rotation), while only one is used for new signatures.
+type SigningKeyManager interface {
+	// SigningKey returns the private/secret key (and its key ID) currently used to sign new tokens.
+	SigningKey() (key interface{}, keyID string, err error)
+
+	// SigningMethod returns the single JWT algorithm this manager's keys are valid for. It pins
+	// verification to that one algorithm (via jwt.WithValidMethods), so a verification key published
+	// for one algorithm can never be misused to validate a token claiming a different one.
+	SigningMethod() JWTSigningMethod
+
+	// VerificationKey returns the public/secret key registered under keyID.
+	VerificationKey(keyID string) (interface{}, error)
+
+	// VerificationKeys returns every currently-valid verification key, keyed by key ID, for publishing
+	// as a JWKS. Values are *rsa.PublicKey or *ecdsa.PublicKey depending on the signing method in use.
+	VerificationKeys() (map[string]interface{}, error)
+}
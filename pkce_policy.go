@@ -0,0 +1,67 @@
+package niso
+
+import "context"
+
+// PKCEPolicy controls whether the authorization_code grant requires a PKCE (rfc7636) code_challenge
+// on this Server.
+type PKCEPolicy int
+
+const (
+	// PKCEOptional is the zero value and niso's historical behavior, so that a Config{} with
+	// PKCEPolicy left unset keeps validating a present code_challenge exactly as before: a
+	// code_challenge is validated if present, but its absence is not an error for any client.
+	PKCEOptional PKCEPolicy = iota
+
+	// PKCEDisabled ignores PKCE entirely: a code_challenge recorded on the authorization data, if
+	// any, is never validated against the token request's code_verifier. This must be opted into
+	// explicitly; it is deliberately not the zero value so that an integrator who has never heard of
+	// PKCEPolicy doesn't silently stop enforcing it.
+	PKCEDisabled
+
+	// PKCERequiredForPublicClients rejects an authorization_code request with E_INVALID_REQUEST if
+	// ClientData.IsPublic is true and no code_challenge was presented during authorization.
+	// Confidential clients are unaffected.
+	PKCERequiredForPublicClients
+
+	// PKCERequiredForAll rejects any authorization_code request that lacks a code_challenge,
+	// regardless of client type.
+	PKCERequiredForAll
+)
+
+// requirePKCE reports whether this policy requires a code_challenge for clientData.
+func (p PKCEPolicy) requirePKCE(clientData *ClientData) bool {
+	switch p {
+	case PKCERequiredForAll:
+		return true
+	case PKCERequiredForPublicClients:
+		return clientData.IsPublic
+	default:
+		return false
+	}
+}
+
+// authenticateClient resolves the client for a token endpoint request, allowing a public client
+// (ClientData.IsPublic) to authenticate with no secret at all. It must only be used by grants that
+// have a real compensating control for the missing client secret: handleAuthorizationCodeRequest
+// (exact redirect_uri match, plus PKCE where PKCEPolicy requires it) and handleRefreshTokenRequest (bearer possession of the refresh
+// token itself). password and client_credentials have no such control and must keep calling
+// getClientDataFromBasicAuth directly, since for client_credentials in particular the secret *is* the
+// entire grant (rfc6749#section-4.4).
+//
+// Confidential clients authenticate as before via getClientDataFromBasicAuth; the public-client
+// fallback only triggers once that has failed and the stored ClientData confirms IsPublic.
+func (s *Server) authenticateClient(ctx context.Context, auth *BasicAuth) (*ClientData, error) {
+	clientData, err := getClientDataFromBasicAuth(ctx, auth, s.Storage)
+	if err == nil {
+		return clientData, nil
+	}
+	if auth == nil || auth.Username == "" {
+		return nil, err
+	}
+
+	clientData, lookupErr := s.Storage.GetClientData(ctx, auth.Username)
+	if lookupErr != nil || clientData == nil || !clientData.IsPublic {
+		return nil, err
+	}
+	return clientData, nil
+}
@@ -0,0 +1,32 @@
+package niso
+
+import "testing"
+
+func TestPKCEPolicy_RequirePKCE(t *testing.T) {
+	public := &ClientData{IsPublic: true}
+	confidential := &ClientData{IsPublic: false}
+
+	cases := []struct {
+		name     string
+		policy   PKCEPolicy
+		client   *ClientData
+		required bool
+	}{
+		{"disabled/public", PKCEDisabled, public, false},
+		{"disabled/confidential", PKCEDisabled, confidential, false},
+		{"optional/public", PKCEOptional, public, false},
+		{"optional/confidential", PKCEOptional, confidential, false},
+		{"required-for-public/public", PKCERequiredForPublicClients, public, true},
+		{"required-for-public/confidential", PKCERequiredForPublicClients, confidential, false},
+		{"required-for-all/public", PKCERequiredForAll, public, true},
+		{"required-for-all/confidential", PKCERequiredForAll, confidential, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := c.policy.requirePKCE(c.client); got != c.required {
+				t.Errorf("requirePKCE() = %v, want %v", got, c.required)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package niso
+
+import (
+	"context"
+	"net/http"
+)
+
+// HandleRevocationRequest is the entry point for handling RFC 7009 token revocation requests.
+// This method will always return a Response, even if there was an error processing the request, which should be
+// rendered for a user. It may also return an error in the second argument which can be logged by the caller.
+//
+// Per RFC 7009 section 2.2, the request is considered successful (and a 200 response returned) even if the token
+// was already invalid, unknown, or already revoked.
+func (s *Server) HandleRevocationRequest(ctx context.Context, r *http.Request) (*Response, error) {
+	if r.Method != "POST" {
+		return toNisoError(NewNisoError(E_INVALID_REQUEST, "revocation requests must POST verb")).AsResponse(), nil
+	}
+
+	auth, err := getClientAuthFromRequest(r, s.Config.AllowClientSecretInParams)
+	if err != nil {
+		return toNisoError(NewWrappedNisoError(E_INVALID_REQUEST, err, "failed to get client authentication")).AsResponse(), nil
+	}
+
+	clientData, err := getClientDataFromBasicAuth(ctx, auth, s.Storage)
+	if err != nil {
+		return toNisoError(err).AsResponse(), nil
+	}
+
+	token := r.FormValue("token")
+	if token == "" {
+		return toNisoError(NewNisoError(E_INVALID_REQUEST, "no token provided")).AsResponse(), nil
+	}
+	tokenTypeHint := IntrospectionTokenTypeHint(r.FormValue("token_type_hint"))
+
+	revokeAccessToken := func() bool {
+		ad, err := s.Storage.LoadAccessData(ctx, token)
+		if err != nil || ad == nil || ad.ClientData == nil || ad.ClientData.ClientID != clientData.ClientID {
+			return false
+		}
+		return s.Storage.DeleteAccessData(ctx, token) == nil
+	}
+	revokeRefreshToken := func() bool {
+		rt, err := s.Storage.GetRefreshTokenData(ctx, token)
+		if err != nil || rt == nil || rt.ClientID != clientData.ClientID {
+			return false
+		}
+		return s.Storage.DeleteRefreshTokenData(ctx, token) == nil
+	}
+
+	if tokenTypeHint == INTROSPECT_REFRESH_TOKEN {
+		if !revokeRefreshToken() {
+			revokeAccessToken()
+		}
+	} else {
+		if !revokeAccessToken() {
+			revokeRefreshToken()
+		}
+	}
+
+	// Always return an empty success response, even if the token was unknown or already revoked.
+	return NewResponse(), nil
+}
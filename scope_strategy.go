@@ -0,0 +1,150 @@
+package niso
+
+import "strings"
+
+// ScopeStrategy decides whether a set of previously granted scopes covers a requested scope, and
+// filters a requested scope down to what's actually granted. It replaces niso's historical ad-hoc,
+// comma-split, exact-match-only comparison so callers can opt into hierarchical scopes.
+type ScopeStrategy interface {
+	// Matches returns true if every scope token in requested is covered by granted.
+	Matches(granted, requested string) bool
+
+	// Filter returns requested if granted covers it in full, or an error (E_INVALID_SCOPE) if
+	// requested asks for something granted doesn't cover. An empty requested returns granted.
+	Filter(granted, requested string) (string, error)
+}
+
+// ExactScopeStrategy requires byte-for-byte equality between scope tokens, space-delimited per
+// https://tools.ietf.org/html/rfc6749#section-3.3. This is niso's default ScopeStrategy.
+//
+// Separator overrides the token delimiter; leave it blank for the RFC 6749 space separator, or set
+// it to "," to preserve niso's pre-1.0 on-the-wire behavior.
+type ExactScopeStrategy struct {
+	Separator string
+}
+
+// Matches implements ScopeStrategy.
+func (s ExactScopeStrategy) Matches(granted, requested string) bool {
+	grantedSet := scopeSet(granted, s.separator())
+	for _, scope := range scopeTokens(requested, s.separator()) {
+		if _, ok := grantedSet[scope]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Filter implements ScopeStrategy.
+func (s ExactScopeStrategy) Filter(granted, requested string) (string, error) {
+	if requested == "" {
+		return granted, nil
+	}
+	if !s.Matches(granted, requested) {
+		return "", NewNisoError(E_INVALID_SCOPE, "requested scope includes a scope not originally granted")
+	}
+	return requested, nil
+}
+
+func (s ExactScopeStrategy) separator() string {
+	if s.Separator == "" {
+		return " "
+	}
+	return s.Separator
+}
+
+// HierarchicScopeStrategy treats scope tokens as dot-separated hierarchies, so a granted scope of
+// "read" covers a requested scope of "read.users" or "read.users.email", mirroring fosite's
+// hierarchic scope strategy. This lets clients request narrower scopes than what they were granted.
+//
+// Separator overrides the token delimiter; see ExactScopeStrategy.Separator.
+type HierarchicScopeStrategy struct {
+	Separator string
+}
+
+// Matches implements ScopeStrategy.
+func (s HierarchicScopeStrategy) Matches(granted, requested string) bool {
+	grantedTokens := scopeTokens(granted, s.separator())
+	for _, reqScope := range scopeTokens(requested, s.separator()) {
+		covered := false
+		for _, g := range grantedTokens {
+			if hierarchicMatch(g, reqScope) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+// Filter implements ScopeStrategy.
+func (s HierarchicScopeStrategy) Filter(granted, requested string) (string, error) {
+	if requested == "" {
+		return granted, nil
+	}
+	if !s.Matches(granted, requested) {
+		return "", NewNisoError(E_INVALID_SCOPE, "requested scope includes a scope not originally granted")
+	}
+	return requested, nil
+}
+
+func (s HierarchicScopeStrategy) separator() string {
+	if s.Separator == "" {
+		return " "
+	}
+	return s.Separator
+}
+
+// hierarchicMatch returns true if requested is granted itself, or a dot-separated descendant of
+// granted (e.g. granted "read" matches requested "read.users.email").
+func hierarchicMatch(granted, requested string) bool {
+	return granted == requested || strings.HasPrefix(requested, granted+".")
+}
+
+// scopeTokens splits a scope string on separator, dropping empty tokens.
+func scopeTokens(scope, separator string) []string {
+	var tokens []string
+	for _, tok := range strings.Split(scope, separator) {
+		if tok != "" {
+			tokens = append(tokens, tok)
+		}
+	}
+	return tokens
+}
+
+func scopeSet(scope, separator string) map[string]struct{} {
+	set := make(map[string]struct{})
+	for _, tok := range scopeTokens(scope, separator) {
+		set[tok] = struct{}{}
+	}
+	return set
+}
+
+// ClientScopeHandler validates that clientData is allowed to request scope, returning an error
+// (typically E_INVALID_SCOPE) if not. It's invoked by the password, client_credentials and
+// jwt-bearer grants with the request's `scope` parameter, and by authorization_code with the scope
+// recorded on the authorization code; the refresh_token grant instead downscopes via ScopeStrategy
+// against the scope of the original grant.
+type ClientScopeHandler func(clientData *ClientData, scope string) error
+
+// scopeStrategy returns the Server's configured ScopeStrategy, defaulting to ExactScopeStrategy.
+func (s *Server) scopeStrategy() ScopeStrategy {
+	if s.Config.ScopeStrategy != nil {
+		return s.Config.ScopeStrategy
+	}
+	return ExactScopeStrategy{}
+}
+
+// checkClientScope invokes Config.ClientScopeHandler, if configured, to confirm clientData is
+// registered for scope.
+func (s *Server) checkClientScope(clientData *ClientData, scope string) error {
+	if s.Config.ClientScopeHandler == nil {
+		return nil
+	}
+	if err := s.Config.ClientScopeHandler(clientData, scope); err != nil {
+		return NewWrappedNisoError(E_INVALID_SCOPE, err, "client is not registered for the requested scope")
+	}
+	return nil
+}
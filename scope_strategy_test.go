@@ -0,0 +1,62 @@
+package niso
+
+import "testing"
+
+func TestExactScopeStrategy(t *testing.T) {
+	s := ExactScopeStrategy{}
+
+	if !s.Matches("read write", "read") {
+		t.Error("expected granted scope to cover an identical requested token")
+	}
+	if s.Matches("read", "read.users") {
+		t.Error("exact strategy must not treat read.users as covered by read")
+	}
+	if s.Matches("read", "write") {
+		t.Error("expected ungranted scope to not match")
+	}
+
+	if _, err := s.Filter("read write", "read"); err != nil {
+		t.Errorf("unexpected error filtering a covered scope: %v", err)
+	}
+	if _, err := s.Filter("read", "write"); err == nil {
+		t.Error("expected an error filtering an uncovered scope")
+	}
+	if got, err := s.Filter("read write", ""); err != nil || got != "read write" {
+		t.Errorf("Filter with empty requested scope = (%q, %v), want (\"read write\", nil)", got, err)
+	}
+}
+
+func TestExactScopeStrategy_LegacyCommaSeparator(t *testing.T) {
+	s := ExactScopeStrategy{Separator: ","}
+
+	if !s.Matches("read,write", "read") {
+		t.Error("expected comma-separated granted scope to cover a requested token")
+	}
+	if s.Matches("read write", "write") {
+		t.Error("a space-delimited granted scope should not match under the comma separator")
+	}
+}
+
+func TestHierarchicScopeStrategy(t *testing.T) {
+	s := HierarchicScopeStrategy{}
+
+	if !s.Matches("read", "read.users") {
+		t.Error("expected granted \"read\" to cover requested \"read.users\"")
+	}
+	if !s.Matches("read", "read.users.email") {
+		t.Error("expected granted \"read\" to cover a deeper descendant \"read.users.email\"")
+	}
+	if s.Matches("read.users", "read") {
+		t.Error("a narrower granted scope must not cover a broader requested scope")
+	}
+	if s.Matches("reader", "read.users") {
+		t.Error("hierarchic matching must respect the dot boundary, not just a string prefix")
+	}
+
+	if _, err := s.Filter("read", "read.users"); err != nil {
+		t.Errorf("unexpected error filtering a covered hierarchic scope: %v", err)
+	}
+	if _, err := s.Filter("read.users", "read"); err == nil {
+		t.Error("expected an error requesting a broader scope than was granted")
+	}
+}
@@ -24,15 +24,13 @@ type Storage interface {
 	// If RefreshToken is not blank, it must save in a way that can be loaded using LoadRefresh.
 	SaveAccessData(ctx context.Context, data *AccessData) error
 
-	//
-	//// LoadAccess retrieves access data by token. ClientData information MUST be loaded together.
-	//// AuthorizeData and AccessData DON'T NEED to be loaded if not easily available.
-	//// Optionally can return error if expired.
-	//LoadAccess(token string) (*AccessData, error)
-	//
-	//// RemoveAccess revokes or deletes an AccessData.
-	//RemoveAccess(token string) error
-	//
+	// LoadAccessData retrieves access data by token. ClientData information MUST be loaded together.
+	// AuthorizeData and AccessData DON'T NEED to be loaded if not easily available.
+	// Optionally can return error if expired.
+	LoadAccessData(ctx context.Context, token string) (*AccessData, error)
+
+	// DeleteAccessData revokes or deletes an AccessData.
+	DeleteAccessData(ctx context.Context, token string) error
 
 	// GetRefreshTokenData retrieves refresh token data from the token string.
 	GetRefreshTokenData(ctx context.Context, token string) (*RefreshTokenData, error)
@@ -42,6 +40,14 @@ type Storage interface {
 
 	// DeleteRefreshTokenData revokes or deletes a RefreshToken.
 	DeleteRefreshTokenData(ctx context.Context, token string) error
+
+	// GetRefreshTokenFamily retrieves every RefreshTokenData sharing the given family id, i.e. every
+	// token descended from the same original issuance via Config.RefreshTokenRotation.
+	GetRefreshTokenFamily(ctx context.Context, familyID string) ([]*RefreshTokenData, error)
+
+	// RevokeRefreshTokenFamily deletes every refresh token sharing the given family id. Used when
+	// reuse of an already-rotated refresh token is detected, to cut off a potentially stolen chain.
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string) error
 }
 
 type NotFoundError struct {